@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AlertWebhookURLEnv names the environment variable holding an optional
+// webhook URL that newly created alerts are POSTed to as JSON, so Discord,
+// Slack or Matrix bots can subscribe without polling the API.
+const AlertWebhookURLEnv = "VIARAIL_ALERT_WEBHOOK_URL"
+
+// LateAlertThresholdMin is the DiffMin above which a station time is
+// alerted on as late; ImprovingAlertThresholdMin is the drop in DiffMin,
+// between consecutive pulls, that is meaningful enough to alert on as an
+// improvement.
+const (
+	LateAlertThresholdMin      = 15
+	ImprovingAlertThresholdMin = 10
+)
+
+// Alert is a service-disruption event derived by diffing two pulls.
+type Alert struct {
+	ID        uint    `json:"id" db:"id"`
+	Type      string  `json:"type" db:"type"`
+	Severity  string  `json:"severity" db:"severity"`
+	Train     string  `json:"train" db:"train"`
+	Station   *string `json:"station" db:"station"`
+	Message   string  `json:"message" db:"message"`
+	FirstSeen string  `json:"first_seen" db:"first_seen"`
+	LastSeen  string  `json:"last_seen" db:"last_seen"`
+	Active    bool    `json:"active" db:"active"`
+}
+
+// diffPull compares the pull currently being inserted against the previous
+// one and materializes rows in the alerts table for meaningful transitions.
+// It runs inside insertData's transaction so alerts are only ever as stale
+// as the pull they were derived from.
+func diffPull(ctx context.Context, tx *sqlx.Tx, sourceName string, newPullID uint, trains []Train, pulledAt string) ([]Alert, error) {
+	var prevPullID uint
+	err := tx.GetContext(ctx, &prevPullID,
+		"SELECT id FROM pulls WHERE id < ? AND source = ? ORDER BY id DESC LIMIT 1", newPullID, sourceName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("selecting previous pull: %w", err)
+	}
+
+	prevTrains, err := getTrains(ctx, tx, prevPullID, true)
+	if err != nil {
+		return nil, fmt.Errorf("loading previous trains: %w", err)
+	}
+
+	prevByName := make(map[string]*Train, len(prevTrains))
+	for _, train := range prevTrains {
+		prevByName[train.Name] = train
+	}
+
+	var newAlerts []Alert
+	seen := make(map[string]bool, len(trains))
+	for _, train := range trains {
+		name := train.Name
+		seen[name] = true
+
+		prev, existed := prevByName[name]
+		if !existed {
+			alert, err := recordAlert(ctx, tx, "new_train", "info", name, nil,
+				fmt.Sprintf("train %s appeared in the feed", name), pulledAt)
+			if err != nil {
+				return nil, err
+			}
+			if alert != nil {
+				newAlerts = append(newAlerts, *alert)
+			}
+			continue
+		}
+
+		if train.Departed != prev.Departed {
+			alert, err := recordAlert(ctx, tx, "departed_changed", "info", name, nil,
+				fmt.Sprintf("train %s departed status changed to %v", name, train.Departed), pulledAt)
+			if err != nil {
+				return nil, err
+			}
+			if alert != nil {
+				newAlerts = append(newAlerts, *alert)
+			}
+		}
+		if train.Arrived != prev.Arrived {
+			alert, err := recordAlert(ctx, tx, "arrived_changed", "info", name, nil,
+				fmt.Sprintf("train %s arrived status changed to %v", name, train.Arrived), pulledAt)
+			if err != nil {
+				return nil, err
+			}
+			if alert != nil {
+				newAlerts = append(newAlerts, *alert)
+			}
+		}
+
+		prevStations := make(map[string]StationTime, len(prev.Times))
+		for _, st := range prev.Times {
+			prevStations[st.Code] = st
+		}
+
+		for _, st := range train.Times {
+			prevSt, ok := prevStations[st.Code]
+			if !ok {
+				continue
+			}
+
+			code := st.Code
+			switch {
+			case st.DiffMin > LateAlertThresholdMin && prevSt.DiffMin <= LateAlertThresholdMin:
+				alert, err := recordAlert(ctx, tx, "delay", "warning", name, &code,
+					fmt.Sprintf("train %s is now %d minutes late at %s", name, st.DiffMin, st.Station), pulledAt)
+				if err != nil {
+					return nil, err
+				}
+				if alert != nil {
+					newAlerts = append(newAlerts, *alert)
+				}
+				if err := resolveAlert(ctx, tx, "improving", name, &code, pulledAt); err != nil {
+					return nil, err
+				}
+			case prevSt.DiffMin-st.DiffMin > ImprovingAlertThresholdMin:
+				alert, err := recordAlert(ctx, tx, "improving", "info", name, &code,
+					fmt.Sprintf("train %s improved by %d minutes at %s", name, prevSt.DiffMin-st.DiffMin, st.Station), pulledAt)
+				if err != nil {
+					return nil, err
+				}
+				if alert != nil {
+					newAlerts = append(newAlerts, *alert)
+				}
+			case st.DiffMin > LateAlertThresholdMin:
+				// Still late, but neither a fresh crossing nor enough of an
+				// improvement to be newsworthy: keep the existing delay
+				// alert active instead of resolving it out from under the
+				// still-ongoing delay.
+				alert, err := recordAlert(ctx, tx, "delay", "warning", name, &code,
+					fmt.Sprintf("train %s is still %d minutes late at %s", name, st.DiffMin, st.Station), pulledAt)
+				if err != nil {
+					return nil, err
+				}
+				if alert != nil {
+					newAlerts = append(newAlerts, *alert)
+				}
+				if err := resolveAlert(ctx, tx, "improving", name, &code, pulledAt); err != nil {
+					return nil, err
+				}
+			default:
+				if err := resolveAlert(ctx, tx, "delay", name, &code, pulledAt); err != nil {
+					return nil, err
+				}
+				if err := resolveAlert(ctx, tx, "improving", name, &code, pulledAt); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for name, prev := range prevByName {
+		if seen[name] || prev.Arrived {
+			continue
+		}
+
+		if err := resolveAllAlerts(ctx, tx, name, pulledAt); err != nil {
+			return nil, err
+		}
+
+		alert, err := recordAlert(ctx, tx, "vanished", "warning", name, nil,
+			fmt.Sprintf("train %s disappeared from the feed while still en route", name), pulledAt)
+		if err != nil {
+			return nil, err
+		}
+		if alert != nil {
+			newAlerts = append(newAlerts, *alert)
+		}
+	}
+
+	return newAlerts, nil
+}
+
+// recordAlert upserts an alert: if an active alert already exists for the
+// same (type, train, station), its last_seen/message are refreshed in place;
+// otherwise a new alert row is inserted and returned so it can be sent to
+// the configured webhook.
+func recordAlert(ctx context.Context, tx *sqlx.Tx, alertType, severity, train string, station *string, message, pulledAt string) (*Alert, error) {
+	var existingID uint
+	err := tx.GetContext(ctx, &existingID, `
+		SELECT id FROM alerts
+		WHERE type = ? AND train = ? AND active = 1
+			AND ((station IS NULL AND ? IS NULL) OR station = ?)`,
+		alertType, train, station, station,
+	)
+	if err == nil {
+		_, err := tx.ExecContext(ctx, "UPDATE alerts SET last_seen = ?, message = ? WHERE id = ?", pulledAt, message, existingID)
+		if err != nil {
+			return nil, fmt.Errorf("updating alert: %w", err)
+		}
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("checking for existing alert: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO alerts (type, severity, train, station, message, first_seen, last_seen, active)
+		VALUES (?,?,?,?,?,?,?,1)`,
+		alertType, severity, train, station, message, pulledAt, pulledAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("inserting alert: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("getting alert id: %w", err)
+	}
+
+	return &Alert{
+		ID: uint(id), Type: alertType, Severity: severity, Train: train,
+		Station: station, Message: message, FirstSeen: pulledAt, LastSeen: pulledAt, Active: true,
+	}, nil
+}
+
+// resolveAlert marks any active alert of the given (type, train, station) as
+// no longer active, since the condition that raised it is no longer true.
+func resolveAlert(ctx context.Context, tx *sqlx.Tx, alertType, train string, station *string, pulledAt string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE alerts SET active = 0, last_seen = ?
+		WHERE type = ? AND train = ? AND active = 1
+			AND ((station IS NULL AND ? IS NULL) OR station = ?)`,
+		pulledAt, alertType, train, station, station,
+	)
+	if err != nil {
+		return fmt.Errorf("resolving alert: %w", err)
+	}
+	return nil
+}
+
+// resolveAllAlerts marks every active alert for a train as no longer active,
+// used when a train stops being tracked.
+func resolveAllAlerts(ctx context.Context, tx *sqlx.Tx, train, pulledAt string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE alerts SET active = 0, last_seen = ? WHERE train = ? AND active = 1", pulledAt, train)
+	if err != nil {
+		return fmt.Errorf("resolving alerts for train: %w", err)
+	}
+	return nil
+}
+
+// notifyAlertWebhook best-effort POSTs newly created alerts to
+// VIARAIL_ALERT_WEBHOOK_URL, if configured. It never blocks or fails the
+// pull that produced the alerts.
+func notifyAlertWebhook(alerts []Alert) {
+	url := os.Getenv(AlertWebhookURLEnv)
+	if url == "" || len(alerts) == 0 {
+		return
+	}
+
+	go func() {
+		for _, alert := range alerts {
+			body, err := json.Marshal(alert)
+			if err != nil {
+				log.Printf("marshaling alert webhook payload: %v", err)
+				continue
+			}
+
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				log.Printf("building alert webhook request: %v", err)
+				continue
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			client := http.Client{Timeout: 10 * time.Second}
+			res, err := client.Do(req)
+			if err != nil {
+				log.Printf("posting alert webhook: %v", err)
+				continue
+			}
+			res.Body.Close()
+		}
+	}()
+}
+
+func getAlerts(ctx context.Context, db *sqlx.DB, activeOnly bool) ([]Alert, error) {
+	var alerts []Alert
+	query := "SELECT * FROM alerts"
+	if activeOnly {
+		query += " WHERE active = 1"
+	}
+	query += " ORDER BY last_seen DESC"
+
+	if err := db.SelectContext(ctx, &alerts, query); err != nil {
+		return nil, fmt.Errorf("selecting alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+func getAlertsByTrain(ctx context.Context, db *sqlx.DB, train string) ([]Alert, error) {
+	var alerts []Alert
+	if err := db.SelectContext(ctx, &alerts, "SELECT * FROM alerts WHERE train = ? ORDER BY last_seen DESC", train); err != nil {
+		return nil, fmt.Errorf("selecting alerts by train: %w", err)
+	}
+
+	return alerts, nil
+}
+
+func getAlertsByStation(ctx context.Context, db *sqlx.DB, station string) ([]Alert, error) {
+	var alerts []Alert
+	if err := db.SelectContext(ctx, &alerts, "SELECT * FROM alerts WHERE station = ? ORDER BY last_seen DESC", station); err != nil {
+		return nil, fmt.Errorf("selecting alerts by station: %w", err)
+	}
+
+	return alerts, nil
+}
+
+func handleGetAlerts(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		activeOnly := r.URL.Query().Get("active") == "true"
+
+		alerts, err := getAlerts(r.Context(), db, activeOnly)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling get alerts: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(alerts); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding alerts: %v", err)
+			return
+		}
+	}
+}
+
+func handleGetAlertsByTrain(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		train := r.PathValue("name")
+
+		alerts, err := getAlertsByTrain(r.Context(), db, train)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling get alerts by train: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(alerts); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding alerts by train: %v", err)
+			return
+		}
+	}
+}
+
+func handleGetAlertsByStation(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		station := r.PathValue("code")
+
+		alerts, err := getAlertsByStation(r.Context(), db, station)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling get alerts by station: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(alerts); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding alerts by station: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func setupAlertsTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatalf("reading schema.sql: %v", err)
+	}
+
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "alerts_test.db"))
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("executing schema: %v", err)
+	}
+
+	return db
+}
+
+func TestDiffPullDetectsLateAndDepartedTransitions(t *testing.T) {
+	ctx := context.Background()
+	db := setupAlertsTestDB(t)
+
+	first := []Train{
+		{
+			Name: "14",
+			Times: []StationTime{
+				{Code: "OTW", Station: "Ottawa", Diff: "0", DiffMin: 0},
+			},
+		},
+	}
+	if err := insertData(ctx, db, "viarail", first); err != nil {
+		t.Fatalf("inserting first pull: %v", err)
+	}
+
+	second := []Train{
+		{
+			Name:     "14",
+			Departed: true,
+			Times: []StationTime{
+				{Code: "OTW", Station: "Ottawa", Diff: "20", DiffMin: 20},
+			},
+		},
+	}
+	if err := insertData(ctx, db, "viarail", second); err != nil {
+		t.Fatalf("inserting second pull: %v", err)
+	}
+
+	alerts, err := getAlertsByTrain(ctx, db, "14")
+	if err != nil {
+		t.Fatalf("getting alerts: %v", err)
+	}
+
+	var sawDelay, sawDeparted bool
+	for _, alert := range alerts {
+		switch alert.Type {
+		case "delay":
+			sawDelay = true
+			if !alert.Active {
+				t.Errorf("delay alert should be active")
+			}
+		case "departed_changed":
+			sawDeparted = true
+		}
+	}
+
+	if !sawDelay {
+		t.Errorf("expected a delay alert, got %+v", alerts)
+	}
+	if !sawDeparted {
+		t.Errorf("expected a departed_changed alert, got %+v", alerts)
+	}
+
+	// A third, steady-state pull where the train is still late (but hasn't
+	// just crossed the threshold, nor improved enough to be newsworthy)
+	// must not resolve the still-active delay alert out from under it.
+	third := []Train{
+		{
+			Name:     "14",
+			Departed: true,
+			Times: []StationTime{
+				{Code: "OTW", Station: "Ottawa", Diff: "22", DiffMin: 22},
+			},
+		},
+	}
+	if err := insertData(ctx, db, "viarail", third); err != nil {
+		t.Fatalf("inserting third pull: %v", err)
+	}
+
+	alertsAfterThird, err := getAlertsByTrain(ctx, db, "14")
+	if err != nil {
+		t.Fatalf("getting alerts after third pull: %v", err)
+	}
+
+	var delayAlerts int
+	for _, alert := range alertsAfterThird {
+		if alert.Type != "delay" {
+			continue
+		}
+		delayAlerts++
+		if !alert.Active {
+			t.Errorf("delay alert should still be active after a steady-state late pull, got %+v", alert)
+		}
+	}
+	if delayAlerts != 1 {
+		t.Errorf("expected exactly one delay alert across pulls, got %d", delayAlerts)
+	}
+}
+
+func TestDiffPullDetectsVanishedTrain(t *testing.T) {
+	ctx := context.Background()
+	db := setupAlertsTestDB(t)
+
+	first := []Train{
+		{
+			Name: "22",
+			Times: []StationTime{
+				{Code: "MTR", Station: "Montreal", Diff: "0", DiffMin: 0},
+			},
+		},
+	}
+	if err := insertData(ctx, db, "viarail", first); err != nil {
+		t.Fatalf("inserting first pull: %v", err)
+	}
+
+	if err := insertData(ctx, db, "viarail", nil); err != nil {
+		t.Fatalf("inserting second pull: %v", err)
+	}
+
+	alerts, err := getAlertsByTrain(ctx, db, "22")
+	if err != nil {
+		t.Fatalf("getting alerts: %v", err)
+	}
+
+	var sawVanished bool
+	for _, alert := range alerts {
+		if alert.Type == "vanished" {
+			sawVanished = true
+			if !alert.Active {
+				t.Errorf("vanished alert should be active, got %+v", alert)
+			}
+		}
+	}
+	if !sawVanished {
+		t.Errorf("expected a vanished alert, got %+v", alerts)
+	}
+
+	activeAlerts, err := getAlerts(ctx, db, true)
+	if err != nil {
+		t.Fatalf("getting active alerts: %v", err)
+	}
+	sawVanished = false
+	for _, alert := range activeAlerts {
+		if alert.Train == "22" && alert.Type == "vanished" {
+			sawVanished = true
+		}
+	}
+	if !sawVanished {
+		t.Errorf("expected the vanished alert to surface in ?active=true, got %+v", activeAlerts)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"viarail/sources"
+)
+
+// SourceConfig describes one configured data source: which adapter to
+// build, what to call it, and how often to poll it. Fields not used by a
+// given Type are ignored.
+type SourceConfig struct {
+	Type                string `json:"type"`
+	Name                string `json:"name"`
+	URL                 string `json:"url,omitempty"`
+	VehiclePositionsURL string `json:"vehiclePositionsURL,omitempty"`
+	TripUpdatesURL      string `json:"tripUpdatesURL,omitempty"`
+	PollInterval        string `json:"pollInterval"`
+}
+
+// Config is the top-level shape of ConfigPath.
+type Config struct {
+	Sources []SourceConfig `json:"sources"`
+}
+
+// defaultConfig preserves this module's original behavior (poll the VIA
+// Rail tracker every two hours) when no config file is present.
+func defaultConfig() Config {
+	return Config{
+		Sources: []SourceConfig{
+			{Type: "viarail", Name: "viarail", PollInterval: "2h"},
+		},
+	}
+}
+
+func loadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("reading config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parsing config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// buildSource constructs the sources.Source named by a SourceConfig's Type.
+func buildSource(cfg SourceConfig) (sources.Source, error) {
+	switch cfg.Type {
+	case "viarail":
+		return sources.NewViaRail(cfg.Name, cfg.URL), nil
+	case "gtfs-rt":
+		return &sources.GTFSRealtime{
+			SourceName:          cfg.Name,
+			VehiclePositionsURL: cfg.VehiclePositionsURL,
+			TripUpdatesURL:      cfg.TripUpdatesURL,
+		}, nil
+	case "entur":
+		return &sources.Entur{SourceName: cfg.Name, URL: cfg.URL}, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", cfg.Type)
+	}
+}
+
+// pollInterval parses a SourceConfig's PollInterval, defaulting to
+// DBUpdateInterval when empty.
+func (c SourceConfig) pollInterval() (time.Duration, error) {
+	if c.PollInterval == "" {
+		return DBUpdateInterval, nil
+	}
+	return time.ParseDuration(c.PollInterval)
+}
+
+// DBUpdateInterval is the default poll interval for a source that doesn't
+// specify its own.
+const DBUpdateInterval = 2 * time.Hour
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"viarail/internal/gtfsrt"
+)
+
+// AlertDelayThresholdMin is the DiffMin beyond which a train is surfaced in
+// the GTFS-RT alerts feed.
+const AlertDelayThresholdMin = 15
+
+// stationTimeLayouts are the time formats seen in the upstream feed's
+// estimated/scheduled fields, tried in order.
+var stationTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"3:04 pm",
+	"15:04",
+}
+
+func parseStationTime(value *string, pulledAt string) (time.Time, bool) {
+	if value == nil || *value == "" || *value == Mdash {
+		return time.Time{}, false
+	}
+
+	for _, layout := range stationTimeLayouts {
+		if t, err := time.Parse(layout, *value); err == nil {
+			if layout == "3:04 pm" || layout == "15:04" {
+				if pull, err := time.Parse(time.RFC3339, pulledAt); err == nil {
+					t = time.Date(pull.Year(), pull.Month(), pull.Day(), t.Hour(), t.Minute(), 0, 0, pull.Location())
+				}
+			}
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func latestPull(ctx context.Context, db *sqlx.DB) (*Pull, error) {
+	pull := new(Pull)
+	if err := sqlx.GetContext(ctx, db, pull, "SELECT id, pulled_at FROM pulls ORDER BY id DESC LIMIT 1"); err != nil {
+		return nil, fmt.Errorf("selecting latest pull: %w", err)
+	}
+
+	return pull, nil
+}
+
+// writeFeed encodes a GTFS-RT FeedMessage as binary protobuf by default, or
+// as JSON when the request has `?format=json`.
+func writeFeed(w http.ResponseWriter, r *http.Request, msg *gtfs.FeedMessage) {
+	if r.URL.Query().Get("format") == "json" {
+		encoded, err := protojson.Marshal(msg)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding gtfs-rt feed as json: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(encoded)
+		return
+	}
+
+	encoded, err := gtfsrt.Marshal(msg)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Printf("encoding gtfs-rt feed as protobuf: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(encoded)
+}
+
+func handleGTFSVehiclePositions(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		pull, err := latestPull(ctx, db)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt vehicle positions: %v", err)
+			return
+		}
+
+		trains, err := getTrains(ctx, db, pull.ID, false)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt vehicle positions: %v", err)
+			return
+		}
+
+		positions := make([]gtfsrt.VehiclePosition, 0, len(trains))
+		for _, train := range trains {
+			positions = append(positions, gtfsrt.VehiclePosition{
+				Name:      train.Name,
+				Latitude:  train.Latitude,
+				Longitude: train.Longitude,
+				Speed:     train.Speed,
+				Direction: train.Direction,
+			})
+		}
+
+		msg := gtfsrt.BuildVehiclePositions(positions, time.Now().UTC())
+		writeFeed(w, r, msg)
+	}
+}
+
+func handleGTFSTripUpdates(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		pull, err := latestPull(ctx, db)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt trip updates: %v", err)
+			return
+		}
+
+		trains, err := getTrains(ctx, db, pull.ID, true)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt trip updates: %v", err)
+			return
+		}
+
+		trips := make([]gtfsrt.TripUpdate, 0, len(trains))
+		for _, train := range trains {
+			stations := make([]gtfsrt.StationUpdate, 0, len(train.Times))
+			for _, st := range train.Times {
+				update := gtfsrt.StationUpdate{Code: st.Code, DelayMin: st.DiffMin}
+
+				if st.Arrival != nil {
+					if t, ok := parseStationTime(st.Arrival.Estimated, pull.PulledAt); ok {
+						update.ArrivalTime = &t
+					} else if t, ok := parseStationTime(st.Arrival.Scheduled, pull.PulledAt); ok {
+						update.ArrivalTime = &t
+					}
+				}
+				if st.Departure != nil {
+					if t, ok := parseStationTime(st.Departure.Estimated, pull.PulledAt); ok {
+						update.DepartureTime = &t
+					} else if t, ok := parseStationTime(st.Departure.Scheduled, pull.PulledAt); ok {
+						update.DepartureTime = &t
+					}
+				}
+
+				if update.ArrivalTime == nil && update.DepartureTime == nil {
+					continue
+				}
+				stations = append(stations, update)
+			}
+
+			trips = append(trips, gtfsrt.TripUpdate{Name: train.Name, Stations: stations})
+		}
+
+		msg := gtfsrt.BuildTripUpdates(trips, time.Now().UTC())
+		writeFeed(w, r, msg)
+	}
+}
+
+func handleGTFSAlerts(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		pull, err := latestPull(ctx, db)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt alerts: %v", err)
+			return
+		}
+
+		trains, err := getTrains(ctx, db, pull.ID, true)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling gtfs-rt alerts: %v", err)
+			return
+		}
+
+		var alerts []gtfsrt.Alert
+		for _, train := range trains {
+			worstDelay := 0
+			for _, st := range train.Times {
+				if st.DiffMin > worstDelay {
+					worstDelay = st.DiffMin
+				}
+			}
+			if worstDelay <= AlertDelayThresholdMin {
+				continue
+			}
+
+			alerts = append(alerts, gtfsrt.Alert{
+				Name:    train.Name,
+				DiffMin: worstDelay,
+				Message: fmt.Sprintf("Train %s is running %d minutes late", train.Name, worstDelay),
+			})
+		}
+
+		msg := gtfsrt.BuildAlerts(alerts, time.Now().UTC())
+		writeFeed(w, r, msg)
+	}
+}
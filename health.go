@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReadyPullStaleness is how old the most recent pull across all sources can
+// be before /readyz reports the service as not ready to serve fresh data.
+const ReadyPullStaleness = 3 * time.Hour
+
+// handleHealthz reports whether the database connection is alive.
+func handleHealthz(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := db.PingContext(r.Context()); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			log.Printf("handling healthz: %v", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleReadyz reports whether the most recent pull is recent enough that
+// clients can trust the data being served.
+func handleReadyz(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		age, err := latestPullAge(r.Context(), db)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			log.Printf("handling readyz: %v", err)
+			return
+		}
+		if age > ReadyPullStaleness {
+			http.Error(w, fmt.Sprintf("most recent pull is %s old", age), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func latestPullAge(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	pull, err := latestPull(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("getting latest pull: %w", err)
+	}
+
+	pulledAt, err := time.Parse(time.RFC3339, pull.PulledAt)
+	if err != nil {
+		return 0, fmt.Errorf("parsing pulled_at: %w", err)
+	}
+
+	return time.Since(pulledAt), nil
+}
@@ -0,0 +1,190 @@
+// Package gtfsrt translates the data this module already collects into
+// GTFS-Realtime FeedMessages, so that transit apps and aggregators that
+// already speak GTFS-RT can consume VIA Rail data without a bespoke client.
+package gtfsrt
+
+import (
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const gtfsRealtimeVersion = "2.0"
+
+// VehiclePosition is the subset of a Train's live telemetry needed to build a
+// GTFS-RT VehiclePositions feed entity.
+type VehiclePosition struct {
+	Name      string
+	Latitude  *float32
+	Longitude *float32
+	Speed     *float32
+	Direction *float32
+}
+
+// StationUpdate is one StopTimeUpdate's worth of arrival/departure data for a
+// single station along a trip.
+type StationUpdate struct {
+	Code          string
+	ArrivalTime   *time.Time
+	DepartureTime *time.Time
+	DelayMin      int
+}
+
+// TripUpdate is the subset of a Train needed to build a GTFS-RT TripUpdates
+// feed entity: its identity plus the station-by-station schedule.
+type TripUpdate struct {
+	Name     string
+	Stations []StationUpdate
+}
+
+// Alert is a single delay-derived service alert.
+type Alert struct {
+	Name    string
+	DiffMin int
+	Message string
+}
+
+func newHeader(timestamp time.Time) *gtfs.FeedHeader {
+	version := gtfsRealtimeVersion
+	incrementality := gtfs.FeedHeader_FULL_DATASET
+	ts := uint64(timestamp.Unix())
+	return &gtfs.FeedHeader{
+		GtfsRealtimeVersion: &version,
+		Incrementality:      &incrementality,
+		Timestamp:           &ts,
+	}
+}
+
+// BuildVehiclePositions builds a FeedMessage containing one VehiclePosition
+// entity per train, mapping Latitude/Longitude/Speed/Direction onto Position
+// and Name onto both the trip and vehicle IDs. Trains missing a latitude or
+// longitude are omitted.
+func BuildVehiclePositions(trains []VehiclePosition, timestamp time.Time) *gtfs.FeedMessage {
+	entities := make([]*gtfs.FeedEntity, 0, len(trains))
+	for _, train := range trains {
+		if train.Latitude == nil || train.Longitude == nil {
+			continue
+		}
+
+		position := &gtfs.Position{
+			Latitude:  train.Latitude,
+			Longitude: train.Longitude,
+		}
+		if train.Speed != nil {
+			position.Speed = train.Speed
+		}
+		if train.Direction != nil {
+			position.Bearing = train.Direction
+		}
+
+		name := train.Name
+		id := train.Name
+		entities = append(entities, &gtfs.FeedEntity{
+			Id: &id,
+			Vehicle: &gtfs.VehiclePosition{
+				Trip: &gtfs.TripDescriptor{
+					TripId: &name,
+				},
+				Vehicle: &gtfs.VehicleDescriptor{
+					Id: &name,
+				},
+				Position: position,
+			},
+		})
+	}
+
+	return &gtfs.FeedMessage{
+		Header: newHeader(timestamp),
+		Entity: entities,
+	}
+}
+
+// BuildTripUpdates builds a FeedMessage containing one TripUpdate entity per
+// train, with one StopTimeUpdate per station. Stations with neither an
+// arrival nor a departure time are omitted.
+func BuildTripUpdates(trips []TripUpdate, timestamp time.Time) *gtfs.FeedMessage {
+	entities := make([]*gtfs.FeedEntity, 0, len(trips))
+	for _, trip := range trips {
+		stopTimeUpdates := make([]*gtfs.TripUpdate_StopTimeUpdate, 0, len(trip.Stations))
+		for _, station := range trip.Stations {
+			if station.ArrivalTime == nil && station.DepartureTime == nil {
+				continue
+			}
+
+			code := station.Code
+			stopTimeUpdate := &gtfs.TripUpdate_StopTimeUpdate{
+				StopId: &code,
+			}
+			delay := int32(station.DelayMin * 60)
+			if station.ArrivalTime != nil {
+				t := station.ArrivalTime.Unix()
+				stopTimeUpdate.Arrival = &gtfs.TripUpdate_StopTimeEvent{
+					Time:  &t,
+					Delay: &delay,
+				}
+			}
+			if station.DepartureTime != nil {
+				t := station.DepartureTime.Unix()
+				stopTimeUpdate.Departure = &gtfs.TripUpdate_StopTimeEvent{
+					Time:  &t,
+					Delay: &delay,
+				}
+			}
+
+			stopTimeUpdates = append(stopTimeUpdates, stopTimeUpdate)
+		}
+
+		name := trip.Name
+		id := trip.Name
+		entities = append(entities, &gtfs.FeedEntity{
+			Id: &id,
+			TripUpdate: &gtfs.TripUpdate{
+				Trip: &gtfs.TripDescriptor{
+					TripId: &name,
+				},
+				StopTimeUpdate: stopTimeUpdates,
+			},
+		})
+	}
+
+	return &gtfs.FeedMessage{
+		Header: newHeader(timestamp),
+		Entity: entities,
+	}
+}
+
+// BuildAlerts builds a FeedMessage containing one Alert entity per train
+// whose delay is significant enough to be worth surfacing.
+func BuildAlerts(alerts []Alert, timestamp time.Time) *gtfs.FeedMessage {
+	entities := make([]*gtfs.FeedEntity, 0, len(alerts))
+	for _, alert := range alerts {
+		id := alert.Name
+		effect := gtfs.Alert_SIGNIFICANT_DELAYS
+		description := alert.Message
+		entities = append(entities, &gtfs.FeedEntity{
+			Id: &id,
+			Alert: &gtfs.Alert{
+				Effect: &effect,
+				InformedEntity: []*gtfs.EntitySelector{
+					{Trip: &gtfs.TripDescriptor{TripId: &id}},
+				},
+				DescriptionText: &gtfs.TranslatedString{
+					Translation: []*gtfs.TranslatedString_Translation{
+						{Text: &description},
+					},
+				},
+			},
+		})
+	}
+
+	return &gtfs.FeedMessage{
+		Header: newHeader(timestamp),
+		Entity: entities,
+	}
+}
+
+// Marshal encodes a FeedMessage as binary protobuf, per the GTFS-RT spec.
+func Marshal(msg *gtfs.FeedMessage) ([]byte, error) {
+	return proto.Marshal(msg)
+}
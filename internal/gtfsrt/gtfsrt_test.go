@@ -0,0 +1,100 @@
+package gtfsrt
+
+import (
+	"testing"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func f32(v float32) *float32 { return &v }
+
+func TestBuildVehiclePositionsDecodesAsProtobuf(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	msg := BuildVehiclePositions([]VehiclePosition{
+		{Name: "14", Latitude: f32(45.4), Longitude: f32(-75.7), Speed: f32(88.2), Direction: f32(180)},
+		{Name: "skip-me"},
+	}, now)
+
+	encoded, err := Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded gtfs.FeedMessage
+	if err := proto.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if len(decoded.Entity) != 1 {
+		t.Fatalf("expected 1 entity (incomplete position skipped), got %d", len(decoded.Entity))
+	}
+	entity := decoded.Entity[0]
+	if entity.GetVehicle().GetTrip().GetTripId() != "14" {
+		t.Errorf("trip id = %q, want %q", entity.GetVehicle().GetTrip().GetTripId(), "14")
+	}
+	if entity.GetVehicle().GetPosition().GetLatitude() != 45.4 {
+		t.Errorf("latitude = %v, want %v", entity.GetVehicle().GetPosition().GetLatitude(), 45.4)
+	}
+}
+
+func TestBuildTripUpdatesSkipsStationsWithNoTimes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	arrival := now.Add(10 * time.Minute)
+	msg := BuildTripUpdates([]TripUpdate{
+		{
+			Name: "14",
+			Stations: []StationUpdate{
+				{Code: "OTW", ArrivalTime: &arrival, DelayMin: 5},
+				{Code: "MTR"},
+			},
+		},
+	}, now)
+
+	encoded, err := Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded gtfs.FeedMessage
+	if err := proto.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	updates := decoded.Entity[0].GetTripUpdate().GetStopTimeUpdate()
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 stop time update, got %d", len(updates))
+	}
+	if updates[0].GetStopId() != "OTW" {
+		t.Errorf("stop id = %q, want %q", updates[0].GetStopId(), "OTW")
+	}
+	if updates[0].GetArrival().GetDelay() != 300 {
+		t.Errorf("delay = %d, want %d", updates[0].GetArrival().GetDelay(), 300)
+	}
+}
+
+func TestBuildAlerts(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	msg := BuildAlerts([]Alert{
+		{Name: "14", DiffMin: 42, Message: "Train 14 is running 42 minutes late"},
+	}, now)
+
+	encoded, err := Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded gtfs.FeedMessage
+	if err := proto.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if len(decoded.Entity) != 1 {
+		t.Fatalf("expected 1 alert entity, got %d", len(decoded.Entity))
+	}
+	translations := decoded.Entity[0].GetAlert().GetDescriptionText().GetTranslation()
+	if len(translations) != 1 || translations[0].GetText() != "Train 14 is running 42 minutes late" {
+		t.Errorf("unexpected description text: %+v", translations)
+	}
+}
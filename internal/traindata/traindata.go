@@ -0,0 +1,73 @@
+// Package traindata holds the domain types shared between the scraper, the
+// pluggable data sources that feed it, and the HTTP API. Keeping them in
+// their own package lets sources/ build Trains without importing package
+// main.
+package traindata
+
+type Pull struct {
+	ID       uint   `json:"id" db:"id"`
+	PulledAt string `json:"pulled_at" db:"pulled_at"`
+	Source   string `json:"source" db:"source"`
+}
+
+type TimeDiff struct {
+	Estimated *string `json:"estimated" db:"estimated"`
+	Scheduled *string `json:"scheduled" db:"scheduled"`
+}
+
+type StationTime struct {
+	TimeDiff
+	ID        uint      `json:"id" db:"id"`
+	TrainID   uint      `json:"-" db:"train_id"`
+	Station   string    `json:"station" db:"station"`
+	Code      string    `json:"code" db:"code"`
+	ETA       *string   `jsob:"eta" db:"eta"`
+	Arrival   *TimeDiff `json:"arrival" db:"arrival"`
+	Departure *TimeDiff `json:"departure" db:"departure"`
+	Diff      string    `json:"diff" db:"diff"`
+	DiffMin   int       `json:"diffMin" db:"diff_min"`
+}
+
+type StationTimeScan struct {
+	StationTime
+	DepartureEstimated *string `db:"departure_estimated"`
+	DepartureScheduled *string `db:"departure_scheduled"`
+	ArrivalEstimated   *string `db:"arrival_estimated"`
+	ArrivalScheduled   *string `db:"arrival_scheduled"`
+}
+
+func (s *StationTimeScan) ToStationTime() StationTime {
+	stationTime := s.StationTime
+	if s.ArrivalScheduled != nil || s.ArrivalEstimated != nil {
+		stationTime.Arrival = &TimeDiff{
+			Estimated: s.ArrivalEstimated,
+			Scheduled: s.ArrivalScheduled,
+		}
+	}
+	if s.DepartureScheduled != nil || s.DepartureEstimated != nil {
+		stationTime.Departure = &TimeDiff{
+			Estimated: s.DepartureEstimated,
+			Scheduled: s.DepartureScheduled,
+		}
+	}
+
+	return stationTime
+}
+
+type Train struct {
+	ID        uint          `json:"id" db:"id"`
+	PullID    uint          `json:"-" db:"pull_id"`
+	Name      string        `json:"name" db:"name"`
+	Latitude  *float32      `json:"lat" db:"latitude"`
+	Longitude *float32      `json:"lng" db:"longitude"`
+	Speed     *float32      `json:"speed" db:"speed"`
+	Direction *float32      `json:"direction" db:"direction"`
+	Poll      *string       `json:"poll" db:"poll"`
+	Departed  bool          `json:"departed" db:"departed"`
+	Arrived   bool          `json:"arrived" db:"arrived"`
+	From      string        `json:"from" db:"from_station"`
+	To        string        `json:"to" db:"to_station"`
+	Instance  string        `json:"instance" db:"instance"`
+	PollMin   *int          `json:"pollMin" db:"poll_min"`
+	Times     []StationTime `json:"times,omitempty"`
+}
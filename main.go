@@ -4,128 +4,156 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
+
+	"viarail/internal/traindata"
+	"viarail/metrics"
+	"viarail/sources"
 )
 
-const ViaDataUrl = "https://tsimobile.viarail.ca/data/allData.json"
 const Mdash = "&mdash;"
 const DBPath = "viarail.db"
-const DBUpdateInterval = 2 * time.Hour
+const ConfigPath = "config.json"
 const ListenAddr = "localhost:8085"
+const DefaultListenMetricsAddr = "localhost:9090"
 
 //go:embed schema.sql
 var schema []byte
 
-type Pull struct {
-	ID       uint   `json:"id" db:"id"`
-	PulledAt string `json:"pulled_at" db:"pulled_at"`
-}
-
-type TimeDiff struct {
-	Estimated *string `json:"estimated" db:"estimated"`
-	Scheduled *string `json:"scheduled" db:"scheduled"`
-}
-
-type StationTime struct {
-	TimeDiff
-	ID        uint      `json:"id" db:"id"`
-	TrainID   uint      `json:"-" db:"train_id"`
-	Station   string    `json:"station" db:"station"`
-	Code      string    `json:"code" db:"code"`
-	ETA       *string   `jsob:"eta" db:"eta"`
-	Arrival   *TimeDiff `json:"arrival" db:"arrival"`
-	Departure *TimeDiff `json:"departure" db:"departure"`
-	Diff      string    `json:"diff" db:"diff"`
-	DiffMin   int       `json:"diffMin" db:"diff_min"`
-}
-
-type StationTimeScan struct {
-	StationTime
-	DepartureEstimated *string `db:"departure_estimated"`
-	DepartureScheduled *string `db:"departure_scheduled"`
-	ArrivalEstimated   *string `db:"arrival_estimated"`
-	ArrivalScheduled   *string `db:"arrival_scheduled"`
-}
-
-func (s *StationTimeScan) ToStationTime() StationTime {
-	stationTime := s.StationTime
-	if s.ArrivalScheduled != nil || s.ArrivalEstimated != nil {
-		stationTime.Arrival = &TimeDiff{
-			Estimated: s.ArrivalEstimated,
-			Scheduled: s.ArrivalScheduled,
-		}
-	}
-	if s.DepartureScheduled != nil || s.DepartureEstimated != nil {
-		stationTime.Departure = &TimeDiff{
-			Estimated: s.DepartureEstimated,
-			Scheduled: s.DepartureScheduled,
-		}
-	}
-
-	return stationTime
-}
-
-type Train struct {
-	ID        uint          `json:"id" db:"id"`
-	PullID    uint          `json:"-" db:"pull_id"`
-	Name      string        `json:"name" db:"name"`
-	Latitude  *float32      `json:"lat" db:"latitude"`
-	Longitude *float32      `json:"lng" db:"longitude"`
-	Speed     *float32      `json:"speed" db:"speed"`
-	Direction *float32      `json:"direction" db:"direction"`
-	Poll      *string       `json:"poll" db:"poll"`
-	Departed  bool          `json:"departed" db:"departed"`
-	Arrived   bool          `json:"arrived" db:"arrived"`
-	From      string        `json:"from" db:"from_station"`
-	To        string        `json:"to" db:"to_station"`
-	Instance  string        `json:"instance" db:"instance"`
-	PollMin   *int          `json:"pollMin" db:"poll_min"`
-	Times     []StationTime `json:"times,omitempty"`
-}
+// Domain types live in internal/traindata so the sources/ package can build
+// them without importing package main.
+type (
+	Pull            = traindata.Pull
+	TimeDiff        = traindata.TimeDiff
+	StationTime     = traindata.StationTime
+	StationTimeScan = traindata.StationTimeScan
+	Train           = traindata.Train
+)
 
 func main() {
+	listenMetricsAddr := flag.String("listen-metrics", DefaultListenMetricsAddr, "address to serve /metrics, /healthz, and /readyz on")
+	flag.Parse()
+
 	ctx := context.Background()
 	db, err := openDB(ctx, DBPath)
 	if err != nil {
 		log.Fatalf("opening database: %v", err)
 	}
 
-	mux := buildMux(db)
+	cfg, err := loadConfig(ConfigPath)
+	if err != nil {
+		log.Fatalf("loading config: %v", err)
+	}
+
+	mux := buildMux(db, cfg)
+	metricsMux := buildMetricsMux(db)
 
-	go updateTask(ctx, db, DBUpdateInterval)
+	go updateTask(ctx, db, cfg)
+
+	go func() {
+		log.Printf("listening for metrics on http://%s", *listenMetricsAddr)
+		log.Print(http.ListenAndServe(*listenMetricsAddr, metricsMux))
+	}()
 
 	log.Printf("listening on http://%s", ListenAddr)
 	panic(http.ListenAndServe(ListenAddr, mux))
 }
 
-func buildMux(db *sqlx.DB) *http.ServeMux {
+func buildMux(db *sqlx.DB, cfg Config) http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("GET /api/pulls/", handleGetPulls(db))
 	mux.Handle("GET /api/pulls/{pullID}", handleGetTrains(db))
 	mux.Handle("GET /api/trains/{trainID}", handleGetTrain(db))
+	mux.Handle("GET /gtfs-rt/vehicle-positions", handleGTFSVehiclePositions(db))
+	mux.Handle("GET /gtfs-rt/trip-updates", handleGTFSTripUpdates(db))
+	mux.Handle("GET /gtfs-rt/alerts", handleGTFSAlerts(db))
+	mux.Handle("GET /api/stats/train/{name}", handleStatsTrain(db))
+	mux.Handle("GET /api/stats/station/{code}", handleStatsStation(db))
+	mux.Handle("GET /api/stats/route/{from}/{to}", handleStatsRoute(db))
+	mux.Handle("GET /api/alerts", handleGetAlerts(db))
+	mux.Handle("GET /api/alerts/train/{name}", handleGetAlertsByTrain(db))
+	mux.Handle("GET /api/alerts/station/{code}", handleGetAlertsByStation(db))
+	mux.Handle("GET /api/sources", handleGetSources(db, cfg))
+	mux.Handle("GET /api/route", handleGetRoute(db))
+	mux.Handle("GET /api/stations", handleGetStations(db))
+	mux.Handle("GET /api/stations/{code}/trains", handleGetStationTrains(db))
+
+	return metrics.Middleware(mux)
+}
+
+// buildMetricsMux serves the operational endpoints on their own mux, so
+// they can be bound to a separate address via --listen-metrics.
+func buildMetricsMux(db *sqlx.DB) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", handleHealthz(db))
+	mux.Handle("GET /readyz", handleReadyz(db))
 
 	return mux
 }
 
-// updateTask pulls in new train data and stores it in the database.
-// It since initially when the program launches, and then once every `DBUpdateInterval`
-func updateTask(ctx context.Context, db *sqlx.DB, updateInterval time.Duration) {
-	ticker := time.NewTicker(updateInterval)
-	for {
-		if err := updateTrainData(ctx, db); err != nil {
-			log.Printf("update train data: %v", err)
+// updateTask spawns one goroutine per configured source, each polling on
+// its own ticker, initially when the program launches and then once every
+// source's PollInterval.
+func updateTask(ctx context.Context, db *sqlx.DB, cfg Config) {
+	var wg sync.WaitGroup
+	for _, sourceCfg := range cfg.Sources {
+		source, err := buildSource(sourceCfg)
+		if err != nil {
+			log.Printf("configuring source %s: %v", sourceCfg.Name, err)
+			continue
 		}
+
+		interval, err := sourceCfg.pollInterval()
+		if err != nil {
+			log.Printf("parsing poll interval for source %s: %v", sourceCfg.Name, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(source sources.Source, interval time.Duration) {
+			defer wg.Done()
+			pollSource(ctx, db, source, interval)
+		}(source, interval)
+	}
+	wg.Wait()
+}
+
+func pollSource(ctx context.Context, db *sqlx.DB, source sources.Source, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		recordPull(ctx, db, source)
 		<-ticker.C
 	}
 }
 
+// recordPull runs one poll of source and records its outcome and duration,
+// regardless of success or failure.
+func recordPull(ctx context.Context, db *sqlx.DB, source sources.Source) {
+	start := time.Now()
+	err := updateTrainData(ctx, db, source)
+	duration := time.Since(start)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+		log.Printf("update train data from %s: %v", source.Name(), err)
+	}
+
+	metrics.PullTotal.WithLabelValues(source.Name(), status).Inc()
+	metrics.PullDuration.WithLabelValues(source.Name()).Observe(duration.Seconds())
+}
+
 func openDB(ctx context.Context, dbPath string) (*sqlx.DB, error) {
 	log.Print("opening database")
 	db, err := sqlx.Open("sqlite3", dbPath)
@@ -133,6 +161,11 @@ func openDB(ctx context.Context, dbPath string) (*sqlx.DB, error) {
 		return nil, fmt.Errorf("opening db: %w", err)
 	}
 
+	// sqlite3 only allows one writer at a time; with several sources polling
+	// concurrently, a second writer would otherwise fail with "database is
+	// locked" instead of simply waiting its turn.
+	db.SetMaxOpenConns(1)
+
 	log.Print("executing schema")
 	if _, err := db.ExecContext(ctx, string(schema)); err != nil {
 		return nil, fmt.Errorf("executing schema: %w", err)
@@ -141,41 +174,42 @@ func openDB(ctx context.Context, dbPath string) (*sqlx.DB, error) {
 	return db, nil
 }
 
-func updateTrainData(ctx context.Context, db *sqlx.DB) error {
-	log.Print("fetching train data")
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ViaDataUrl, nil)
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
-	}
-	res, err := http.DefaultClient.Do(req)
+func updateTrainData(ctx context.Context, db *sqlx.DB, source sources.Source) error {
+	log.Printf("fetching train data from %s", source.Name())
+	trains, err := source.Fetch(ctx)
 	if err != nil {
 		return fmt.Errorf("fetching train data: %w", err)
 	}
-	defer res.Body.Close()
-
-	log.Print("decoding train data")
-	data := map[string]Train{}
-	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
-		return fmt.Errorf("decoding train data: %w", err)
-	}
 
 	log.Print("inserting train data")
-	if err := insertData(ctx, db, data); err != nil {
+	if err := insertData(ctx, db, source.Name(), trains); err != nil {
 		return fmt.Errorf("inserting train data: %w", err)
 	}
 
+	metrics.PullTrainsCount.WithLabelValues(source.Name()).Set(float64(len(trains)))
+	for _, train := range trains {
+		for _, st := range train.Times {
+			metrics.TrainDelayMinutes.WithLabelValues(train.Name).Observe(float64(st.DiffMin))
+		}
+	}
+
+	if info, err := os.Stat(DBPath); err == nil {
+		metrics.DBSizeBytes.Set(float64(info.Size()))
+	}
+
 	return nil
 }
 
-func insertData(ctx context.Context, db *sqlx.DB, data map[string]Train) error {
+func insertData(ctx context.Context, db *sqlx.DB, sourceName string, trains []Train) error {
 	log.Print("begninning tx")
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin train tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	res, err := tx.ExecContext(ctx, "INSERT INTO pulls (pulled_at) VALUES (?)", time.Now().UTC().Format(time.RFC3339))
+	pulledAt := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, "INSERT INTO pulls (pulled_at, source) VALUES (?, ?)", pulledAt, sourceName)
 	if err != nil {
 		return fmt.Errorf("inserting pull time: %w", err)
 	}
@@ -185,7 +219,8 @@ func insertData(ctx context.Context, db *sqlx.DB, data map[string]Train) error {
 		return fmt.Errorf("getting pull id: %w", err)
 	}
 
-	for name, details := range data {
+	for _, details := range trains {
+		name := details.Name
 		train, err := tx.ExecContext(ctx, `
 			INSERT INTO trains (
 				pull_id,
@@ -289,20 +324,44 @@ func insertData(ctx context.Context, db *sqlx.DB, data map[string]Train) error {
 		}
 	}
 
+	log.Print("diffing against previous pull")
+	newAlerts, err := diffPull(ctx, tx, sourceName, uint(pullID), trains, pulledAt)
+	if err != nil {
+		return fmt.Errorf("diffing pull: %w", err)
+	}
+
 	log.Print("committing data")
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing train tx: %w", err)
+	}
+
+	notifyAlertWebhook(newAlerts)
+
+	return nil
 }
 
-func getPulls(ctx context.Context, db *sqlx.DB) ([]Pull, error) {
+func getPulls(ctx context.Context, db *sqlx.DB, source string) ([]Pull, error) {
 	var pulls []Pull
-	if err := db.SelectContext(ctx, &pulls, "SELECT id, pulled_at FROM pulls ORDER BY id"); err != nil {
+	err := db.SelectContext(ctx, &pulls, `
+		SELECT id, pulled_at, source FROM pulls
+		WHERE ? = '' OR source = ?
+		ORDER BY id`,
+		source, source,
+	)
+	if err != nil {
 		return nil, fmt.Errorf("selecting pulls: %w", err)
 	}
 
 	return pulls, nil
 }
 
-func getTrains(ctx context.Context, db *sqlx.DB, pullID uint, fullData bool) ([]*Train, error) {
+// selector is satisfied by both *sqlx.DB and *sqlx.Tx, so queries can run
+// against either an ordinary connection or an in-flight transaction.
+type selector interface {
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+func getTrains(ctx context.Context, db selector, pullID uint, fullData bool) ([]*Train, error) {
 	var trains []*Train
 	if err := db.SelectContext(ctx, &trains, "SELECT * FROM trains WHERE pull_id = ? ORDER BY name", pullID); err != nil {
 		return nil, fmt.Errorf("select trains: %w", err)
@@ -337,7 +396,7 @@ func getTrain(ctx context.Context, db *sqlx.DB, trainID uint) (*Train, error) {
 	return train, nil
 }
 
-func getStationTimes(ctx context.Context, db *sqlx.DB, trainID uint) ([]StationTime, error) {
+func getStationTimes(ctx context.Context, db selector, trainID uint) ([]StationTime, error) {
 	var stationTimes []StationTime
 	var stationTimeScans []StationTimeScan
 	if err := db.SelectContext(ctx, &stationTimeScans, "SELECT * FROM station_times WHERE train_id = ? ORDER BY id", trainID); err != nil {
@@ -353,7 +412,7 @@ func getStationTimes(ctx context.Context, db *sqlx.DB, trainID uint) ([]StationT
 
 func handleGetPulls(db *sqlx.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		pulls, err := getPulls(r.Context(), db)
+		pulls, err := getPulls(r.Context(), db, r.URL.Query().Get("source"))
 		if err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			log.Printf("handling get pulls: %v", err)
@@ -391,7 +450,7 @@ func handleGetTrains(db *sqlx.DB) http.HandlerFunc {
 
 		if err := json.NewEncoder(w).Encode(trains); err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			log.Printf("encoding trains: %w", err)
+			log.Printf("encoding trains: %v", err)
 			return
 		}
 	}
@@ -415,7 +474,59 @@ func handleGetTrain(db *sqlx.DB) http.HandlerFunc {
 
 		if err := json.NewEncoder(w).Encode(train); err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			log.Printf("encoding trains: %w", err)
+			log.Printf("encoding trains: %v", err)
+			return
+		}
+	}
+}
+
+// SourceStatus describes one configured source and when it last
+// successfully reported data.
+type SourceStatus struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	LastPull *string `json:"lastPull"`
+}
+
+func getSourceStatuses(ctx context.Context, db *sqlx.DB, cfg Config) ([]SourceStatus, error) {
+	var lastPulls []struct {
+		Source   string `db:"source"`
+		LastPull string `db:"last_pull"`
+	}
+	err := db.SelectContext(ctx, &lastPulls, "SELECT source, MAX(pulled_at) AS last_pull FROM pulls GROUP BY source")
+	if err != nil {
+		return nil, fmt.Errorf("selecting last pulls: %w", err)
+	}
+
+	lastPullByName := make(map[string]string, len(lastPulls))
+	for _, row := range lastPulls {
+		lastPullByName[row.Source] = row.LastPull
+	}
+
+	statuses := make([]SourceStatus, 0, len(cfg.Sources))
+	for _, sourceCfg := range cfg.Sources {
+		status := SourceStatus{Name: sourceCfg.Name, Type: sourceCfg.Type}
+		if lastPull, ok := lastPullByName[sourceCfg.Name]; ok {
+			status.LastPull = &lastPull
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func handleGetSources(db *sqlx.DB, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := getSourceStatuses(r.Context(), db, cfg)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling get sources: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding sources: %v", err)
 			return
 		}
 	}
@@ -0,0 +1,106 @@
+// Package metrics defines the Prometheus collectors this module publishes
+// and a small HTTP middleware that drives the request-count/duration pair
+// from any *http.ServeMux, so handlers don't need to be instrumented
+// individually.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// PullTotal counts source polls by outcome.
+	PullTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "viarail_pull_total",
+		Help: "Count of source polls, labeled by source and outcome (ok/error).",
+	}, []string{"source", "status"})
+
+	// PullDuration times a single call to updateTrainData.
+	PullDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "viarail_pull_duration_seconds",
+		Help:    "Time spent fetching and storing one source's data.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"source"})
+
+	// PullTrainsCount is the number of trains returned by the most recent
+	// successful pull, by source.
+	PullTrainsCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "viarail_pull_trains_count",
+		Help: "Number of trains returned by the most recent successful pull, by source.",
+	}, []string{"source"})
+
+	// HTTPRequestsTotal counts served requests by route pattern and status
+	// code.
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "viarail_http_requests_total",
+		Help: "Count of HTTP requests served, labeled by route pattern and status code.",
+	}, []string{"route", "code"})
+
+	// HTTPRequestDuration times served requests by route pattern.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "viarail_http_request_duration_seconds",
+		Help:    "HTTP request latency, labeled by route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	// DBSizeBytes is the size of the sqlite database file on disk.
+	DBSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "viarail_db_size_bytes",
+		Help: "Size in bytes of the sqlite database file on disk.",
+	})
+
+	// TrainDelayMinutes is the distribution of station_times diff_min
+	// values seen across pulls, by train name.
+	TrainDelayMinutes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "viarail_train_delay_minutes",
+		Help:    "Distribution of station delay minutes from each pull, labeled by train name.",
+		Buckets: []float64{-10, -5, 0, 5, 10, 15, 20, 30, 45, 60, 90, 120},
+	}, []string{"train"})
+)
+
+// Handler serves the default registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// unmatchedRoute labels requests that didn't match any registered pattern
+// (404s, bad methods, etc.), so that clients probing arbitrary URLs can't
+// blow up the route label's cardinality.
+const unmatchedRoute = "unmatched"
+
+// Middleware wraps mux, recording HTTPRequestsTotal and HTTPRequestDuration
+// for every request under the route pattern mux itself matched, so handlers
+// need no changes to be instrumented.
+func Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = unmatchedRoute
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+
+		HTTPRequestsTotal.WithLabelValues(pattern, strconv.Itoa(rec.status)).Inc()
+		HTTPRequestDuration.WithLabelValues(pattern).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder captures the status code a handler wrote, defaulting to
+// 200 if WriteHeader is never called.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StationRef is one (code, station) pair a client can use to populate an
+// autocomplete picker.
+type StationRef struct {
+	Code    string `json:"code" db:"code"`
+	Station string `json:"station" db:"station"`
+}
+
+// RoutePair identifies one train's pass through both stations within a
+// single pull, by the station_times row ids bracketing the journey.
+type RoutePair struct {
+	TrainID uint `db:"train_id"`
+	FromID  uint `db:"from_id"`
+	ToID    uint `db:"to_id"`
+}
+
+// RouteJourney is one train's pass between two stations within a pull: the
+// matched from/to StationTimes, everything scheduled in between, and the
+// elapsed scheduled/estimated durations.
+type RouteJourney struct {
+	Train                    Train         `json:"train"`
+	From                     StationTime   `json:"from"`
+	To                       StationTime   `json:"to"`
+	Intermediate             []StationTime `json:"intermediate"`
+	ScheduledDurationSeconds *int64        `json:"scheduledDurationSeconds"`
+	EstimatedDurationSeconds *int64        `json:"estimatedDurationSeconds"`
+}
+
+// resolvePull parses rawPullID if given, otherwise falls back to the latest
+// pull across all sources.
+func resolvePull(ctx context.Context, db *sqlx.DB, rawPullID string) (*Pull, error) {
+	if rawPullID == "" {
+		return latestPull(ctx, db)
+	}
+
+	pullID, err := strconv.Atoi(rawPullID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pull id: %w", err)
+	}
+
+	return getPull(ctx, db, uint(pullID))
+}
+
+func getPull(ctx context.Context, db *sqlx.DB, pullID uint) (*Pull, error) {
+	var pulls []Pull
+	if err := db.SelectContext(ctx, &pulls, "SELECT id, pulled_at, source FROM pulls WHERE id = ?", pullID); err != nil {
+		return nil, fmt.Errorf("select pull: %w", err)
+	}
+	if len(pulls) == 0 {
+		return nil, fmt.Errorf("pull %d not found", pullID)
+	}
+
+	return &pulls[0], nil
+}
+
+func getStations(ctx context.Context, db *sqlx.DB) ([]StationRef, error) {
+	var stations []StationRef
+	if err := db.SelectContext(ctx, &stations, "SELECT DISTINCT code, station FROM station_times ORDER BY station"); err != nil {
+		return nil, fmt.Errorf("selecting stations: %w", err)
+	}
+
+	return stations, nil
+}
+
+// getRoutePairs self-joins station_times on train_id to find every train,
+// within pullID, whose Times include both fromCode and toCode with fromCode
+// preceding toCode.
+func getRoutePairs(ctx context.Context, db selector, fromCode, toCode string, pullID uint) ([]RoutePair, error) {
+	var pairs []RoutePair
+	err := db.SelectContext(ctx, &pairs, `
+		SELECT a.train_id AS train_id, a.id AS from_id, b.id AS to_id
+		FROM station_times a
+		JOIN station_times b ON a.train_id = b.train_id
+		JOIN trains t ON t.id = a.train_id
+		WHERE a.code = ? AND b.code = ? AND a.id < b.id AND t.pull_id = ?
+		ORDER BY a.train_id`,
+		fromCode, toCode, pullID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("selecting route pairs: %w", err)
+	}
+
+	return pairs, nil
+}
+
+// getStationTimesByIDRange pulls the intermediate stops between two
+// station_times ids on the same train, inclusive of both ends.
+func getStationTimesByIDRange(ctx context.Context, db selector, fromID, toID uint) ([]StationTime, error) {
+	var scans []StationTimeScan
+	if err := db.SelectContext(ctx, &scans, "SELECT * FROM station_times WHERE id BETWEEN ? AND ? ORDER BY id", fromID, toID); err != nil {
+		return nil, fmt.Errorf("select station_times range: %w", err)
+	}
+
+	times := make([]StationTime, 0, len(scans))
+	for _, scan := range scans {
+		times = append(times, scan.ToStationTime())
+	}
+
+	return times, nil
+}
+
+func getTrainByID(ctx context.Context, db selector, trainID uint) (*Train, error) {
+	var trains []Train
+	if err := db.SelectContext(ctx, &trains, "SELECT * FROM trains WHERE id = ?", trainID); err != nil {
+		return nil, fmt.Errorf("select train: %w", err)
+	}
+	if len(trains) == 0 {
+		return nil, fmt.Errorf("train %d not found", trainID)
+	}
+
+	return &trains[0], nil
+}
+
+// stationTimeBounds mirrors journeyRow.times(): prefer the departure pair,
+// then arrival, then the plain estimated/scheduled columns.
+func stationTimeBounds(st StationTime) (estimated, scheduled *string) {
+	if st.Departure != nil && (st.Departure.Estimated != nil || st.Departure.Scheduled != nil) {
+		return st.Departure.Estimated, st.Departure.Scheduled
+	}
+	if st.Arrival != nil && (st.Arrival.Estimated != nil || st.Arrival.Scheduled != nil) {
+		return st.Arrival.Estimated, st.Arrival.Scheduled
+	}
+
+	return st.Estimated, st.Scheduled
+}
+
+// journeyDurationSeconds computes the elapsed scheduled and estimated
+// duration between from and to, leaving either nil when the underlying
+// times can't be parsed.
+func journeyDurationSeconds(from, to StationTime, pulledAt string) (scheduled, estimated *int64) {
+	fromEst, fromSch := stationTimeBounds(from)
+	toEst, toSch := stationTimeBounds(to)
+
+	if t1, ok1 := parseStationTime(fromSch, pulledAt); ok1 {
+		if t2, ok2 := parseStationTime(toSch, pulledAt); ok2 {
+			d := int64(t2.Sub(t1).Seconds())
+			scheduled = &d
+		}
+	}
+	if t1, ok1 := parseStationTime(fromEst, pulledAt); ok1 {
+		if t2, ok2 := parseStationTime(toEst, pulledAt); ok2 {
+			d := int64(t2.Sub(t1).Seconds())
+			estimated = &d
+		}
+	}
+
+	return scheduled, estimated
+}
+
+func getRouteJourneys(ctx context.Context, db *sqlx.DB, fromCode, toCode string, pull Pull) ([]RouteJourney, error) {
+	pairs, err := getRoutePairs(ctx, db, fromCode, toCode, pull.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	journeys := make([]RouteJourney, 0, len(pairs))
+	for _, pair := range pairs {
+		times, err := getStationTimesByIDRange(ctx, db, pair.FromID, pair.ToID)
+		if err != nil {
+			return nil, fmt.Errorf("loading intermediate station times: %w", err)
+		}
+		if len(times) < 2 {
+			continue
+		}
+
+		train, err := getTrainByID(ctx, db, pair.TrainID)
+		if err != nil {
+			return nil, fmt.Errorf("loading train %d: %w", pair.TrainID, err)
+		}
+
+		from, to := times[0], times[len(times)-1]
+		scheduledDuration, estimatedDuration := journeyDurationSeconds(from, to, pull.PulledAt)
+
+		journeys = append(journeys, RouteJourney{
+			Train:                    *train,
+			From:                     from,
+			To:                       to,
+			Intermediate:             times[1 : len(times)-1],
+			ScheduledDurationSeconds: scheduledDuration,
+			EstimatedDurationSeconds: estimatedDuration,
+		})
+	}
+
+	return journeys, nil
+}
+
+// getTrainsAtStation returns every train that passes through code within
+// pull, ordered by its scheduled time at that station. Ordering is done in
+// Go, not SQL, since the scheduled columns are raw upstream time strings
+// (parsed by parseStationTime) rather than something that sorts correctly
+// as text.
+func getTrainsAtStation(ctx context.Context, db *sqlx.DB, code string, pull Pull) ([]*Train, error) {
+	var rows []struct {
+		TrainID   uint    `db:"train_id"`
+		Scheduled *string `db:"scheduled"`
+	}
+	err := db.SelectContext(ctx, &rows, `
+		SELECT
+			st.train_id AS train_id,
+			COALESCE(st.departure_scheduled, st.arrival_scheduled, st.scheduled) AS scheduled
+		FROM station_times st
+		JOIN trains t ON t.id = st.train_id
+		WHERE st.code = ? AND t.pull_id = ?`,
+		code, pull.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("selecting trains at station: %w", err)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		ti, oki := parseStationTime(rows[i].Scheduled, pull.PulledAt)
+		tj, okj := parseStationTime(rows[j].Scheduled, pull.PulledAt)
+		if !oki {
+			return false
+		}
+		if !okj {
+			return true
+		}
+		return ti.Before(tj)
+	})
+
+	trains := make([]*Train, 0, len(rows))
+	for _, row := range rows {
+		train, err := getTrain(ctx, db, row.TrainID)
+		if err != nil {
+			return nil, fmt.Errorf("loading train %d: %w", row.TrainID, err)
+		}
+		trains = append(trains, train)
+	}
+
+	return trains, nil
+}
+
+func handleGetRoute(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fromCode := r.URL.Query().Get("from")
+		toCode := r.URL.Query().Get("to")
+		if fromCode == "" || toCode == "" {
+			http.Error(w, "from and to are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		pull, err := resolvePull(ctx, db, r.URL.Query().Get("pullID"))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			log.Printf("handling route query: %v", err)
+			return
+		}
+
+		journeys, err := getRouteJourneys(ctx, db, fromCode, toCode, *pull)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling route query: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(journeys); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding route query: %v", err)
+			return
+		}
+	}
+}
+
+func handleGetStations(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stations, err := getStations(r.Context(), db)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling get stations: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(stations); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding stations: %v", err)
+			return
+		}
+	}
+}
+
+func handleGetStationTrains(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.PathValue("code")
+		ctx := r.Context()
+
+		pull, err := resolvePull(ctx, db, r.URL.Query().Get("pullID"))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			log.Printf("handling station trains: %v", err)
+			return
+		}
+
+		trains, err := getTrainsAtStation(ctx, db, code, *pull)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling station trains: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(trains); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding station trains: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"viarail/internal/traindata"
+)
+
+// Entur queries a configurable Entur/JourneyPlanner-style JSON API for
+// EstimatedCall entries and maps them onto Train/StationTime records, keyed
+// by service journey ID.
+type Entur struct {
+	SourceName string
+	URL        string
+}
+
+func (e *Entur) Name() string {
+	return e.SourceName
+}
+
+// enturResponse mirrors the shape of a StopPlace query against Entur's
+// JourneyPlanner GraphQL API, trimmed to the fields this adapter uses.
+type enturResponse struct {
+	Data struct {
+		StopPlace struct {
+			EstimatedCalls []enturEstimatedCall `json:"estimatedCalls"`
+		} `json:"stopPlace"`
+	} `json:"data"`
+}
+
+type enturEstimatedCall struct {
+	ServiceJourney struct {
+		ID string `json:"id"`
+	} `json:"serviceJourney"`
+	Quay struct {
+		Name       string `json:"name"`
+		PublicCode string `json:"publicCode"`
+	} `json:"quay"`
+	AimedArrivalTime      *string `json:"aimedArrivalTime"`
+	ExpectedArrivalTime   *string `json:"expectedArrivalTime"`
+	AimedDepartureTime    *string `json:"aimedDepartureTime"`
+	ExpectedDepartureTime *string `json:"expectedDepartureTime"`
+}
+
+func (e *Entur) Fetch(ctx context.Context) ([]traindata.Train, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching estimated calls: %w", err)
+	}
+	defer res.Body.Close()
+
+	var parsed enturResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decoding estimated calls: %w", err)
+	}
+
+	byJourney := map[string]*traindata.Train{}
+	trainFor := func(journeyID string) *traindata.Train {
+		train, ok := byJourney[journeyID]
+		if !ok {
+			train = &traindata.Train{Name: journeyID}
+			byJourney[journeyID] = train
+		}
+		return train
+	}
+
+	for _, call := range parsed.Data.StopPlace.EstimatedCalls {
+		if call.ServiceJourney.ID == "" {
+			continue
+		}
+
+		train := trainFor(call.ServiceJourney.ID)
+		code := call.Quay.PublicCode
+		if code == "" {
+			code = call.Quay.Name
+		}
+
+		train.Times = append(train.Times, traindata.StationTime{
+			Station:   call.Quay.Name,
+			Code:      code,
+			Arrival:   &traindata.TimeDiff{Estimated: call.ExpectedArrivalTime, Scheduled: call.AimedArrivalTime},
+			Departure: &traindata.TimeDiff{Estimated: call.ExpectedDepartureTime, Scheduled: call.AimedDepartureTime},
+		})
+	}
+
+	trains := make([]traindata.Train, 0, len(byJourney))
+	for _, train := range byJourney {
+		trains = append(trains, *train)
+	}
+
+	return trains, nil
+}
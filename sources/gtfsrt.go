@@ -0,0 +1,157 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+
+	"viarail/internal/traindata"
+)
+
+// GTFSRealtime ingests any transit agency's VehiclePositions and TripUpdates
+// GTFS-RT protobuf feeds and translates them into Train/StationTime records,
+// keyed by trip ID the same way the VIA Rail feed is keyed by train name.
+type GTFSRealtime struct {
+	SourceName          string
+	VehiclePositionsURL string
+	TripUpdatesURL      string
+}
+
+func (g *GTFSRealtime) Name() string {
+	return g.SourceName
+}
+
+func (g *GTFSRealtime) Fetch(ctx context.Context) ([]traindata.Train, error) {
+	vehiclePositions, err := fetchFeedMessage(ctx, g.VehiclePositionsURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching vehicle positions: %w", err)
+	}
+
+	tripUpdates, err := fetchFeedMessage(ctx, g.TripUpdatesURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching trip updates: %w", err)
+	}
+
+	byTrip := map[string]*traindata.Train{}
+	trainFor := func(tripID string) *traindata.Train {
+		train, ok := byTrip[tripID]
+		if !ok {
+			train = &traindata.Train{Name: tripID}
+			byTrip[tripID] = train
+		}
+		return train
+	}
+
+	for _, entity := range vehiclePositions.GetEntity() {
+		vehicle := entity.GetVehicle()
+		if vehicle == nil {
+			continue
+		}
+		tripID := vehicle.GetTrip().GetTripId()
+		if tripID == "" {
+			continue
+		}
+
+		train := trainFor(tripID)
+		if position := vehicle.GetPosition(); position != nil {
+			lat, lng := position.GetLatitude(), position.GetLongitude()
+			train.Latitude = &lat
+			train.Longitude = &lng
+			if position.Speed != nil {
+				speed := position.GetSpeed()
+				train.Speed = &speed
+			}
+			if position.Bearing != nil {
+				bearing := position.GetBearing()
+				train.Direction = &bearing
+			}
+		}
+	}
+
+	for _, entity := range tripUpdates.GetEntity() {
+		update := entity.GetTripUpdate()
+		if update == nil {
+			continue
+		}
+		tripID := update.GetTrip().GetTripId()
+		if tripID == "" {
+			continue
+		}
+
+		train := trainFor(tripID)
+		for _, stopTimeUpdate := range update.GetStopTimeUpdate() {
+			train.Times = append(train.Times, stopTimeUpdateToStationTime(stopTimeUpdate))
+		}
+	}
+
+	trains := make([]traindata.Train, 0, len(byTrip))
+	for _, train := range byTrip {
+		trains = append(trains, *train)
+	}
+
+	return trains, nil
+}
+
+func stopTimeUpdateToStationTime(stu *gtfs.TripUpdate_StopTimeUpdate) traindata.StationTime {
+	code := stu.GetStopId()
+	st := traindata.StationTime{Station: code, Code: code}
+
+	if arrival := stu.GetArrival(); arrival != nil {
+		st.Arrival = timeDiffFromStopTimeEvent(arrival)
+		st.DiffMin = int(arrival.GetDelay()) / 60
+	} else if departure := stu.GetDeparture(); departure != nil {
+		st.DiffMin = int(departure.GetDelay()) / 60
+	}
+	if departure := stu.GetDeparture(); departure != nil {
+		st.Departure = timeDiffFromStopTimeEvent(departure)
+	}
+	st.Diff = fmt.Sprintf("%d", st.DiffMin)
+
+	return st
+}
+
+func timeDiffFromStopTimeEvent(event *gtfs.TripUpdate_StopTimeEvent) *traindata.TimeDiff {
+	if event.Time == nil {
+		return nil
+	}
+
+	estimated := time.Unix(event.GetTime(), 0).UTC().Format(time.RFC3339)
+	td := &traindata.TimeDiff{Estimated: &estimated}
+
+	if event.Delay != nil {
+		scheduled := time.Unix(event.GetTime()-int64(event.GetDelay()), 0).UTC().Format(time.RFC3339)
+		td.Scheduled = &scheduled
+	}
+
+	return td
+}
+
+func fetchFeedMessage(ctx context.Context, url string) (*gtfs.FeedMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching feed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading feed body: %w", err)
+	}
+
+	msg := new(gtfs.FeedMessage)
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("unmarshaling feed: %w", err)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,24 @@
+// Package sources defines the pluggable data source abstraction used to
+// populate the database: a Source knows how to fetch the current state of
+// a fleet of trains from some upstream, and updateTask polls whichever
+// sources are configured on their own schedule.
+package sources
+
+import (
+	"context"
+
+	"viarail/internal/traindata"
+)
+
+// Source is one upstream that can be polled for the current state of a
+// fleet of trains.
+type Source interface {
+	// Name identifies this source instance, e.g. for the pulls.source
+	// column and the /api/sources listing. It is not necessarily the same
+	// as the adapter type: two configured ViaRail sources would need two
+	// different names.
+	Name() string
+	// Fetch returns every train currently reported by the upstream, with
+	// Name populated on each one.
+	Fetch(ctx context.Context) ([]traindata.Train, error)
+}
@@ -0,0 +1,157 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestViaRailFetchSetsNameFromMapKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"14": map[string]any{"departed": true},
+		})
+	}))
+	defer server.Close()
+
+	source := NewViaRail("viarail", server.URL)
+	trains, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(trains) != 1 {
+		t.Fatalf("expected 1 train, got %d", len(trains))
+	}
+	if trains[0].Name != "14" {
+		t.Errorf("name = %q, want %q", trains[0].Name, "14")
+	}
+	if !trains[0].Departed {
+		t.Errorf("expected departed = true")
+	}
+}
+
+func TestGTFSRealtimeFetchMergesPositionsAndUpdates(t *testing.T) {
+	timestamp := uint64(time.Unix(1700000000, 0).Unix())
+	version := "2.0"
+	lat, lng := float32(45.4), float32(-75.7)
+	tripID := "14"
+	stopID := "OTW"
+	arrivalTime := int64(1700003600)
+
+	vehicleMsg := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{Timestamp: &timestamp, GtfsRealtimeVersion: &version},
+		Entity: []*gtfs.FeedEntity{
+			{
+				Id: &tripID,
+				Vehicle: &gtfs.VehiclePosition{
+					Trip:     &gtfs.TripDescriptor{TripId: &tripID},
+					Position: &gtfs.Position{Latitude: &lat, Longitude: &lng},
+				},
+			},
+		},
+	}
+	tripMsg := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{Timestamp: &timestamp, GtfsRealtimeVersion: &version},
+		Entity: []*gtfs.FeedEntity{
+			{
+				Id: &tripID,
+				TripUpdate: &gtfs.TripUpdate{
+					Trip: &gtfs.TripDescriptor{TripId: &tripID},
+					StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
+						{
+							StopId:  &stopID,
+							Arrival: &gtfs.TripUpdate_StopTimeEvent{Time: &arrivalTime},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	vehicleServer := protobufServer(t, vehicleMsg)
+	defer vehicleServer.Close()
+	tripServer := protobufServer(t, tripMsg)
+	defer tripServer.Close()
+
+	source := &GTFSRealtime{
+		SourceName:          "gtfs-rt-test",
+		VehiclePositionsURL: vehicleServer.URL,
+		TripUpdatesURL:      tripServer.URL,
+	}
+
+	trains, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(trains) != 1 {
+		t.Fatalf("expected 1 train, got %d", len(trains))
+	}
+
+	train := trains[0]
+	if train.Name != tripID {
+		t.Errorf("name = %q, want %q", train.Name, tripID)
+	}
+	if train.Latitude == nil || *train.Latitude != lat {
+		t.Errorf("latitude = %v, want %v", train.Latitude, lat)
+	}
+	if len(train.Times) != 1 || train.Times[0].Code != stopID {
+		t.Fatalf("unexpected station times: %+v", train.Times)
+	}
+}
+
+func protobufServer(t *testing.T, msg *gtfs.FeedMessage) *httptest.Server {
+	t.Helper()
+	encoded, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshaling feed message: %v", err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encoded)
+	}))
+}
+
+func TestEnturFetchMapsEstimatedCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"stopPlace": map[string]any{
+					"estimatedCalls": []map[string]any{
+						{
+							"serviceJourney":        map[string]any{"id": "RUT:ServiceJourney:1"},
+							"quay":                  map[string]any{"name": "Oslo S", "publicCode": "1"},
+							"aimedArrivalTime":      "2026-01-01T10:00:00Z",
+							"expectedArrivalTime":   "2026-01-01T10:05:00Z",
+							"aimedDepartureTime":    "2026-01-01T10:01:00Z",
+							"expectedDepartureTime": "2026-01-01T10:06:00Z",
+						},
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	source := &Entur{SourceName: "entur-test", URL: server.URL}
+	trains, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(trains) != 1 {
+		t.Fatalf("expected 1 train, got %d", len(trains))
+	}
+	if trains[0].Name != "RUT:ServiceJourney:1" {
+		t.Errorf("name = %q", trains[0].Name)
+	}
+	if len(trains[0].Times) != 1 || trains[0].Times[0].Code != "1" {
+		t.Fatalf("unexpected station times: %+v", trains[0].Times)
+	}
+	if trains[0].Times[0].Arrival == nil || *trains[0].Times[0].Arrival.Estimated != "2026-01-01T10:05:00Z" {
+		t.Errorf("unexpected arrival: %+v", trains[0].Times[0].Arrival)
+	}
+}
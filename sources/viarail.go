@@ -0,0 +1,60 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"viarail/internal/traindata"
+)
+
+// DefaultViaRailURL is the upstream VIA Rail tracker JSON endpoint this
+// module has always scraped.
+const DefaultViaRailURL = "https://tsimobile.viarail.ca/data/allData.json"
+
+// ViaRail is the original data source: VIA Rail's internal tracker, which
+// reports trains as a JSON object keyed by train name.
+type ViaRail struct {
+	SourceName string
+	URL        string
+}
+
+// NewViaRail builds a ViaRail source, defaulting URL to DefaultViaRailURL
+// when empty.
+func NewViaRail(name, url string) *ViaRail {
+	if url == "" {
+		url = DefaultViaRailURL
+	}
+	return &ViaRail{SourceName: name, URL: url}
+}
+
+func (v *ViaRail) Name() string {
+	return v.SourceName
+}
+
+func (v *ViaRail) Fetch(ctx context.Context) ([]traindata.Train, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching train data: %w", err)
+	}
+	defer res.Body.Close()
+
+	data := map[string]traindata.Train{}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding train data: %w", err)
+	}
+
+	trains := make([]traindata.Train, 0, len(data))
+	for name, train := range data {
+		train.Name = name
+		trains = append(trains, train)
+	}
+
+	return trains, nil
+}
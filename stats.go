@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultOnTimeThresholdMin is the absolute delay, in minutes, at or under
+// which a station time is considered on-time when no ?threshold= is given.
+const DefaultOnTimeThresholdMin = 5
+
+// delayRow is one station_times row joined against its train and pull, with
+// everything needed to compute a delay in minutes.
+type delayRow struct {
+	TrainName          string  `db:"train_name"`
+	Code               string  `db:"code"`
+	Station            string  `db:"station"`
+	PulledAt           string  `db:"pulled_at"`
+	Estimated          *string `db:"estimated"`
+	Scheduled          *string `db:"scheduled"`
+	DepartureEstimated *string `db:"departure_estimated"`
+	DepartureScheduled *string `db:"departure_scheduled"`
+	ArrivalEstimated   *string `db:"arrival_estimated"`
+	ArrivalScheduled   *string `db:"arrival_scheduled"`
+	DiffMin            int     `db:"diff_min"`
+}
+
+// delayMinutes derives a delay in minutes for a row by parsing the most
+// specific estimated/scheduled pair available, falling back to the
+// already-computed diff_min column when both sides were Mdash.
+func (r delayRow) delayMinutes() int {
+	pairs := [][2]*string{
+		{r.ArrivalEstimated, r.ArrivalScheduled},
+		{r.DepartureEstimated, r.DepartureScheduled},
+		{r.Estimated, r.Scheduled},
+	}
+	for _, pair := range pairs {
+		est, ok := parseStationTime(pair[0], r.PulledAt)
+		if !ok {
+			continue
+		}
+		sch, ok := parseStationTime(pair[1], r.PulledAt)
+		if !ok {
+			continue
+		}
+		return int(est.Sub(sch).Minutes())
+	}
+
+	return r.DiffMin
+}
+
+// DelayStats summarizes a set of delay-minute samples.
+type DelayStats struct {
+	Count           int     `json:"count"`
+	MeanDelayMin    float64 `json:"meanDelayMin"`
+	MedianDelayMin  float64 `json:"medianDelayMin"`
+	P90DelayMin     float64 `json:"p90DelayMin"`
+	OnTimePercent   float64 `json:"onTimePercent"`
+	WorstDelayMin   int     `json:"worstDelayMin"`
+	OnTimeThreshold int     `json:"onTimeThresholdMin"`
+}
+
+func computeDelayStats(delays []int, thresholdMin int) DelayStats {
+	if len(delays) == 0 {
+		return DelayStats{OnTimeThreshold: thresholdMin}
+	}
+
+	sorted := append([]int(nil), delays...)
+	sort.Ints(sorted)
+
+	var sum, onTime, worst int
+	worst = sorted[0]
+	for _, d := range sorted {
+		sum += d
+		if d > worst {
+			worst = d
+		}
+		if d < 0 {
+			if -d <= thresholdMin {
+				onTime++
+			}
+		} else if d <= thresholdMin {
+			onTime++
+		}
+	}
+
+	return DelayStats{
+		Count:           len(sorted),
+		MeanDelayMin:    float64(sum) / float64(len(sorted)),
+		MedianDelayMin:  percentile(sorted, 50),
+		P90DelayMin:     percentile(sorted, 90),
+		OnTimePercent:   100 * float64(onTime) / float64(len(sorted)),
+		WorstDelayMin:   worst,
+		OnTimeThreshold: thresholdMin,
+	}
+}
+
+// percentile assumes sorted is already sorted ascending.
+func percentile(sorted []int, p float64) float64 {
+	if len(sorted) == 1 {
+		return float64(sorted[0])
+	}
+
+	rank := (p / 100) * float64(len(sorted)-1)
+	low := int(rank)
+	high := low + 1
+	if high >= len(sorted) {
+		return float64(sorted[low])
+	}
+
+	frac := rank - float64(low)
+	return float64(sorted[low])*(1-frac) + float64(sorted[high])*frac
+}
+
+func parseWindow(r *http.Request) (from, to string) {
+	return r.URL.Query().Get("from"), r.URL.Query().Get("to")
+}
+
+func parseThreshold(r *http.Request) int {
+	raw := r.URL.Query().Get("threshold")
+	if raw == "" {
+		return DefaultOnTimeThresholdMin
+	}
+	threshold, err := strconv.Atoi(raw)
+	if err != nil {
+		return DefaultOnTimeThresholdMin
+	}
+	return threshold
+}
+
+func getTrainDelayRows(ctx context.Context, db *sqlx.DB, trainName, from, to string) ([]delayRow, error) {
+	var rows []delayRow
+	err := db.SelectContext(ctx, &rows, `
+		SELECT
+			t.name AS train_name,
+			st.code AS code,
+			st.station AS station,
+			p.pulled_at AS pulled_at,
+			st.estimated AS estimated,
+			st.scheduled AS scheduled,
+			st.departure_estimated AS departure_estimated,
+			st.departure_scheduled AS departure_scheduled,
+			st.arrival_estimated AS arrival_estimated,
+			st.arrival_scheduled AS arrival_scheduled,
+			st.diff_min AS diff_min
+		FROM station_times st
+		JOIN trains t ON t.id = st.train_id
+		JOIN pulls p ON p.id = t.pull_id
+		WHERE t.name = ?
+			AND (? = '' OR p.pulled_at >= ?)
+			AND (? = '' OR p.pulled_at <= ?)
+		ORDER BY p.id, st.id`,
+		trainName, from, from, to, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("selecting train delay rows: %w", err)
+	}
+
+	return rows, nil
+}
+
+func getStationDelayRows(ctx context.Context, db *sqlx.DB, code, from, to string) ([]delayRow, error) {
+	var rows []delayRow
+	err := db.SelectContext(ctx, &rows, `
+		SELECT
+			t.name AS train_name,
+			st.code AS code,
+			st.station AS station,
+			p.pulled_at AS pulled_at,
+			st.estimated AS estimated,
+			st.scheduled AS scheduled,
+			st.departure_estimated AS departure_estimated,
+			st.departure_scheduled AS departure_scheduled,
+			st.arrival_estimated AS arrival_estimated,
+			st.arrival_scheduled AS arrival_scheduled,
+			st.diff_min AS diff_min
+		FROM station_times st
+		JOIN trains t ON t.id = st.train_id
+		JOIN pulls p ON p.id = t.pull_id
+		WHERE st.code = ?
+			AND (? = '' OR p.pulled_at >= ?)
+			AND (? = '' OR p.pulled_at <= ?)
+		ORDER BY p.id, st.id`,
+		code, from, from, to, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("selecting station delay rows: %w", err)
+	}
+
+	return rows, nil
+}
+
+func handleStatsTrain(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		from, to := parseWindow(r)
+
+		rows, err := getTrainDelayRows(r.Context(), db, name, from, to)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling train stats: %v", err)
+			return
+		}
+
+		delays := make([]int, len(rows))
+		for idx, row := range rows {
+			delays[idx] = row.delayMinutes()
+		}
+
+		if err := json.NewEncoder(w).Encode(computeDelayStats(delays, parseThreshold(r))); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding train stats: %v", err)
+			return
+		}
+	}
+}
+
+func handleStatsStation(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.PathValue("code")
+		from, to := parseWindow(r)
+
+		rows, err := getStationDelayRows(r.Context(), db, code, from, to)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling station stats: %v", err)
+			return
+		}
+
+		delays := make([]int, len(rows))
+		for idx, row := range rows {
+			delays[idx] = row.delayMinutes()
+		}
+
+		if err := json.NewEncoder(w).Encode(computeDelayStats(delays, parseThreshold(r))); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding station stats: %v", err)
+			return
+		}
+	}
+}
+
+// RouteStationProgression is one station's aggregate delay along a route.
+type RouteStationProgression struct {
+	Code         string  `json:"code"`
+	Station      string  `json:"station"`
+	Count        int     `json:"count"`
+	MeanDelayMin float64 `json:"meanDelayMin"`
+}
+
+// JourneySample is one train's predicted-vs-actual journey time between two
+// stations on a single pull, suitable for feeding into a regression.
+type JourneySample struct {
+	Train                       string `json:"train"`
+	PullID                      uint   `json:"pullID"`
+	PredictedJourneyTimeSeconds int64  `json:"predicted_journey_time_seconds"`
+	ActualJourneyTimeSeconds    int64  `json:"actual_journey_time_seconds"`
+}
+
+// RouteStats describes lateness progression and journey-time samples between
+// two stations.
+type RouteStats struct {
+	Stations []RouteStationProgression `json:"stations"`
+	Samples  []JourneySample           `json:"samples"`
+}
+
+func handleStatsRoute(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fromCode := r.PathValue("from")
+		toCode := r.PathValue("to")
+		from, to := parseWindow(r)
+
+		ctx := r.Context()
+
+		stations, err := getRouteProgression(ctx, db, fromCode, toCode, from, to)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling route stats: %v", err)
+			return
+		}
+
+		samples, err := getJourneySamples(ctx, db, fromCode, toCode, from, to)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("handling route stats: %v", err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(RouteStats{Stations: stations, Samples: samples}); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.Printf("encoding route stats: %v", err)
+			return
+		}
+	}
+}
+
+// getRouteProgression aggregates delay by station code for every train/pull
+// whose Times include both fromCode and toCode, restricted to the stations
+// between them, ordered by the station's earliest-seen position along the
+// line.
+func getRouteProgression(ctx context.Context, db *sqlx.DB, fromCode, toCode, from, to string) ([]RouteStationProgression, error) {
+	var rows []delayRow
+	err := db.SelectContext(ctx, &rows, `
+		SELECT
+			t.name AS train_name,
+			st.code AS code,
+			st.station AS station,
+			p.pulled_at AS pulled_at,
+			st.estimated AS estimated,
+			st.scheduled AS scheduled,
+			st.departure_estimated AS departure_estimated,
+			st.departure_scheduled AS departure_scheduled,
+			st.arrival_estimated AS arrival_estimated,
+			st.arrival_scheduled AS arrival_scheduled,
+			st.diff_min AS diff_min
+		FROM station_times st
+		JOIN trains t ON t.id = st.train_id
+		JOIN pulls p ON p.id = t.pull_id
+		JOIN (
+			SELECT a.train_id AS train_id, a.id AS from_id, b.id AS to_id
+			FROM station_times a
+			JOIN station_times b ON a.train_id = b.train_id
+			WHERE a.code = ? AND b.code = ? AND a.id < b.id
+		) pair ON pair.train_id = st.train_id
+		WHERE st.id BETWEEN pair.from_id AND pair.to_id
+			AND (? = '' OR p.pulled_at >= ?)
+			AND (? = '' OR p.pulled_at <= ?)
+		ORDER BY st.id`,
+		fromCode, toCode, from, from, to, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("selecting route progression rows: %w", err)
+	}
+
+	type agg struct {
+		station string
+		firstID int
+		delays  []int
+	}
+	order := []string{}
+	byCode := map[string]*agg{}
+	for idx, row := range rows {
+		a, ok := byCode[row.Code]
+		if !ok {
+			a = &agg{station: row.Station, firstID: idx}
+			byCode[row.Code] = a
+			order = append(order, row.Code)
+		}
+		a.delays = append(a.delays, row.delayMinutes())
+	}
+
+	progression := make([]RouteStationProgression, 0, len(order))
+	for _, code := range order {
+		a := byCode[code]
+		stats := computeDelayStats(a.delays, DefaultOnTimeThresholdMin)
+		progression = append(progression, RouteStationProgression{
+			Code:         code,
+			Station:      a.station,
+			Count:        stats.Count,
+			MeanDelayMin: stats.MeanDelayMin,
+		})
+	}
+
+	return progression, nil
+}
+
+// journeyRow is one station_time row used to locate a train's departure or
+// arrival at a single station within a single pull.
+type journeyRow struct {
+	PullID             uint    `db:"pull_id"`
+	TrainName          string  `db:"train_name"`
+	PulledAt           string  `db:"pulled_at"`
+	Estimated          *string `db:"estimated"`
+	Scheduled          *string `db:"scheduled"`
+	DepartureEstimated *string `db:"departure_estimated"`
+	DepartureScheduled *string `db:"departure_scheduled"`
+	ArrivalEstimated   *string `db:"arrival_estimated"`
+	ArrivalScheduled   *string `db:"arrival_scheduled"`
+}
+
+// times prefers the departure pair, then arrival, then the plain
+// estimated/scheduled columns. Used for a journey's origin station.
+func (j journeyRow) times() (estimated, scheduled *string) {
+	if j.DepartureEstimated != nil || j.DepartureScheduled != nil {
+		return j.DepartureEstimated, j.DepartureScheduled
+	}
+	if j.ArrivalEstimated != nil || j.ArrivalScheduled != nil {
+		return j.ArrivalEstimated, j.ArrivalScheduled
+	}
+	return j.Estimated, j.Scheduled
+}
+
+// arrivalTimes prefers the arrival pair, then departure, then the plain
+// estimated/scheduled columns. Used for a journey's destination station.
+func (j journeyRow) arrivalTimes() (estimated, scheduled *string) {
+	if j.ArrivalEstimated != nil || j.ArrivalScheduled != nil {
+		return j.ArrivalEstimated, j.ArrivalScheduled
+	}
+	if j.DepartureEstimated != nil || j.DepartureScheduled != nil {
+		return j.DepartureEstimated, j.DepartureScheduled
+	}
+	return j.Estimated, j.Scheduled
+}
+
+// getJourneySamples pairs each train's time at fromCode with its time at
+// toCode within the same pull, to build predicted-vs-actual journey-time
+// samples suitable for a regression.
+func getJourneySamples(ctx context.Context, db *sqlx.DB, fromCode, toCode, from, to string) ([]JourneySample, error) {
+	rowsAt := func(code string) ([]journeyRow, error) {
+		var rows []journeyRow
+		err := db.SelectContext(ctx, &rows, `
+			SELECT
+				p.id AS pull_id,
+				t.name AS train_name,
+				p.pulled_at AS pulled_at,
+				st.estimated AS estimated,
+				st.scheduled AS scheduled,
+				st.departure_estimated AS departure_estimated,
+				st.departure_scheduled AS departure_scheduled,
+				st.arrival_estimated AS arrival_estimated,
+				st.arrival_scheduled AS arrival_scheduled
+			FROM station_times st
+			JOIN trains t ON t.id = st.train_id
+			JOIN pulls p ON p.id = t.pull_id
+			WHERE st.code = ?
+				AND (? = '' OR p.pulled_at >= ?)
+				AND (? = '' OR p.pulled_at <= ?)`,
+			code, from, from, to, to,
+		)
+		return rows, err
+	}
+
+	originRows, err := rowsAt(fromCode)
+	if err != nil {
+		return nil, fmt.Errorf("selecting origin rows: %w", err)
+	}
+	destRows, err := rowsAt(toCode)
+	if err != nil {
+		return nil, fmt.Errorf("selecting destination rows: %w", err)
+	}
+
+	type key struct {
+		pullID uint
+		train  string
+	}
+	destByKey := map[key]journeyRow{}
+	for _, row := range destRows {
+		destByKey[key{row.PullID, row.TrainName}] = row
+	}
+
+	var samples []JourneySample
+	for _, origin := range originRows {
+		dest, ok := destByKey[key{origin.PullID, origin.TrainName}]
+		if !ok {
+			continue
+		}
+
+		originEst, originSch := origin.times()
+		destEst, destSch := dest.arrivalTimes()
+
+		originEstT, ok1 := parseStationTime(originEst, origin.PulledAt)
+		destEstT, ok2 := parseStationTime(destEst, dest.PulledAt)
+		originSchT, ok3 := parseStationTime(originSch, origin.PulledAt)
+		destSchT, ok4 := parseStationTime(destSch, dest.PulledAt)
+		if !(ok1 && ok2 && ok3 && ok4) {
+			continue
+		}
+
+		actual := destEstT.Sub(originEstT)
+		predicted := destSchT.Sub(originSchT)
+		if actual <= 0 || predicted <= 0 {
+			continue
+		}
+
+		samples = append(samples, JourneySample{
+			Train:                       origin.TrainName,
+			PullID:                      origin.PullID,
+			PredictedJourneyTimeSeconds: int64(predicted.Seconds()),
+			ActualJourneyTimeSeconds:    int64(actual.Seconds()),
+		})
+	}
+
+	return samples, nil
+}